@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// hclIdentRe matches an unquoted identifier at the start of a line followed
+// by "=" or "{", the telltale shape of HCL's assignment and block syntax.
+var hclIdentRe = regexp.MustCompile(`(?m)^\s*[A-Za-z_][A-Za-z0-9_-]*\s*[={]`)
+
+// DetectFormat guesses the encoding of a configuration document from name's
+// extension and, failing that, a lightweight sniff of peek's leading bytes.
+// It returns "" when detection is ambiguous, in which case the caller should
+// fall back to trying every known parser in turn.
+//
+// A leading '{'/'[' is deliberately NOT treated as a confident "json" guess:
+// JSON5 documents (comments, trailing commas, unquoted keys) can start with
+// the exact same byte, so reporting "json" here would skip the json5
+// fallback entirely and turn an ambiguous case into a wrong, unrecoverable
+// guess. HCL's bare-identifier shape, by contrast, is not valid JSON/JSON5
+// at all, so it's safe to report with confidence.
+func DetectFormat(name string, peek []byte) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".json":
+		return "json"
+	case ".json5":
+		return "json5"
+	case ".hcl", ".tf":
+		return "hcl"
+	case ".yaml", ".yml":
+		return "yaml"
+	}
+
+	if hclIdentRe.Match(bytes.TrimSpace(peek)) {
+		return "hcl"
+	}
+
+	return ""
+}
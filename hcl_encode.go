@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// hclBareIdentRe matches the identifiers HCL can write unquoted on the
+// left-hand side of an assignment.
+var hclBareIdentRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+// EncodeHCL writes raw to w using HCL's own assignment/object syntax
+// ("key = value", nested maps as "{ ... }" object literals) rather than
+// reusing encoding/json, so --out-format=hcl produces actual HCL instead of
+// JSON wearing an HCL label.
+func EncodeHCL(w io.Writer, raw interface{}) error {
+	bw := bufio.NewWriter(w)
+
+	switch val := raw.(type) {
+	case map[string]interface{}:
+		writeHCLObjectBody(bw, val, 0)
+	default:
+		// A document that isn't a top-level object (e.g. the result of a
+		// --query projection) has nowhere to hang its key, so bind it to a
+		// single synthetic assignment.
+		bw.WriteString("value = ")
+		writeHCLValue(bw, raw, 0)
+		bw.WriteString("\n")
+	}
+
+	return bw.Flush()
+}
+
+func writeHCLObjectBody(w *bufio.Writer, m map[string]interface{}, indent int) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pad := strings.Repeat("  ", indent)
+	for _, k := range keys {
+		w.WriteString(pad)
+		w.WriteString(hclKey(k))
+		w.WriteString(" = ")
+		writeHCLValue(w, m[k], indent)
+		w.WriteString("\n")
+	}
+}
+
+func writeHCLValue(w *bufio.Writer, v interface{}, indent int) {
+	switch val := v.(type) {
+	case nil:
+		w.WriteString("null")
+	case bool:
+		if val {
+			w.WriteString("true")
+		} else {
+			w.WriteString("false")
+		}
+	case float64:
+		w.WriteString(formatHCLNumber(val))
+	case string:
+		w.WriteString(strconv.Quote(val))
+	case []interface{}:
+		w.WriteString("[")
+		for i, elem := range val {
+			if i > 0 {
+				w.WriteString(", ")
+			}
+			writeHCLValue(w, elem, indent)
+		}
+		w.WriteString("]")
+	case map[string]interface{}:
+		w.WriteString("{\n")
+		writeHCLObjectBody(w, val, indent+1)
+		w.WriteString(strings.Repeat("  ", indent))
+		w.WriteString("}")
+	default:
+		// Shouldn't happen for documents produced by cfgt's own parsers,
+		// but fall back to a quoted string rather than emitting invalid HCL.
+		w.WriteString(strconv.Quote(fmt.Sprintf("%v", val)))
+	}
+}
+
+// formatHCLNumber prints f without a trailing ".0" for integral values,
+// matching how HCL authors normally write integer literals.
+func formatHCLNumber(f float64) string {
+	if f == float64(int64(f)) {
+		return strconv.FormatInt(int64(f), 10)
+	}
+
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// hclKey quotes k only when it isn't a valid bare HCL identifier.
+func hclKey(k string) string {
+	if hclBareIdentRe.MatchString(k) {
+		return k
+	}
+
+	return strconv.Quote(k)
+}
@@ -8,11 +8,17 @@ import (
 	"github.com/pkg/errors"
 )
 
+// Version is the running cfgt version, compared against a template's
+// declared min_version by the render command.
+const Version = "0.1"
+
 type GlobalConfig struct {
 	Debug       bool
 	InFilename  string
 	OutFilename string
 	OutFormat   string
+	InPlace     bool
+	Backup      string
 }
 
 func ConfigureGlobals(app *kingpin.Application) (*GlobalConfig, error) {
@@ -29,6 +35,11 @@ func ConfigureGlobals(app *kingpin.Application) (*GlobalConfig, error) {
 		Short('o').
 		Default("-").
 		StringVar(&cfg.OutFilename)
+	app.Flag("in-place", "Edit the input file in place (like gofmt -w): writes to a temp file in the same directory, fsyncs it, then renames it over the input. Refused when reading from stdin.").
+		Short('w').
+		BoolVar(&cfg.InPlace)
+	app.Flag("backup", "When used with --in-place, preserve the original file at its name plus this suffix (e.g. --backup=.bak)").
+		StringVar(&cfg.Backup)
 
 	return cfg, nil
 }
@@ -45,13 +56,17 @@ func configureApp(app *kingpin.Application) error {
 		return errors.Wrap(err, "unable to configure parse command")
 	}
 
+	if err := ConfigureRenderCommand(app, globals); err != nil {
+		return errors.Wrap(err, "unable to configure render command")
+	}
+
 	return nil
 }
 
 func main() {
 	app := kingpin.New("cfgt", "A configuration file translation utility")
 	app.Author("Joyent, Inc.")
-	app.Version("0.1")
+	app.Version(Version)
 	if err := configureApp(app); err != nil {
 		type stackTracer interface {
 			StackTrace() errors.StackTrace
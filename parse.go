@@ -8,13 +8,19 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 
+	"github.com/BurntSushi/toml"
 	"github.com/flynn/json5"
+	"github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/hcl"
 	isatty "github.com/mattn/go-isatty"
 	"github.com/pkg/errors"
 	kingpin "gopkg.in/alecthomas/kingpin.v2"
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/sean-/cfgt/query"
 )
 
 const (
@@ -27,6 +33,9 @@ type ParseMode struct {
 	PrettyPrint  bool
 	InputFormat  string
 	OutputFormat string
+	Query        string
+	Stream       string
+	MaxDocSize   int
 }
 
 func NewParseMode(globals *GlobalConfig) ParseMode {
@@ -43,12 +52,12 @@ func ConfigureParseCommand(app *kingpin.Application, globals *GlobalConfig) erro
 		Default().
 		Action(parseMode.run)
 
-	parseCommand.Flag("in-format", `Input format ("json", "json5", or "hcl")`).
+	parseCommand.Flag("in-format", `Input format ("json", "json5", "hcl", or "yaml")`).
 		Short('I').
 		Default("*").
 		StringVar(&parseMode.InputFormat)
 
-	parseCommand.Flag("out-format", `Output format ("json")`).
+	parseCommand.Flag("out-format", `Output format ("json", "json5", "yaml", "toml", or "hcl")`).
 		Short('O').
 		Default("json").
 		StringVar(&parseMode.OutputFormat)
@@ -58,174 +67,508 @@ func ConfigureParseCommand(app *kingpin.Application, globals *GlobalConfig) erro
 		Default(fmt.Sprintf("%t", isatty.IsTerminal(os.Stdout.Fd()))).
 		BoolVar(&parseMode.PrettyPrint)
 
+	parseCommand.Flag("query", `JSONPath/jq-lite expression to project out of the decoded document before encoding (e.g. ".builders[0].type")`).
+		Short('q').
+		StringVar(&parseMode.Query)
+
+	parseCommand.Flag("stream", `Stream a large "json"/"json5" input of concatenated documents instead of slurping it whole, emitting one output document per input value: "ndjson" for newline-delimited output, or "array" to wrap the output in a single streamed JSON array. --pretty is ignored while streaming.`).
+		Default("").
+		StringVar(&parseMode.Stream)
+
+	parseCommand.Flag("max-doc-size", "Maximum size, in bytes, of a single document while streaming; 0 disables the guard").
+		Default("0").
+		IntVar(&parseMode.MaxDocSize)
+
 	return nil
 }
 
-func (m *ParseMode) run(c *kingpin.ParseContext) error {
-	var f *os.File
-	var err error
-	if m.InFilename == "-" {
-		// When the input is stdin, write the input to a tempfile so in the event of
-		// an error highlightPosition() can scan the file to provide a useful hint
-		// regarding the syntax error.
-		f, err = ioutil.TempFile(os.TempDir(), "json5")
-		if err != nil {
-			return errors.Wrap(err, "unable to create temp file for stdin")
-		}
-		defer os.Remove(f.Name())
-		defer f.Close()
+// Diagnostic describes a single format's parse failure, carrying enough
+// positional detail to render a highlighted snippet of the offending input.
+type Diagnostic struct {
+	Format  string
+	Line    int
+	Col     int
+	Offset  int64
+	Snippet string
+	Cause   error
+}
 
-		w := bufio.NewWriterSize(f, m.BufferSize)
-		io.Copy(w, bufio.NewReaderSize(os.Stdin, m.BufferSize))
-		err = w.Flush()
-		if err != nil {
-			return errors.Wrap(err, "unable to flush temp file")
-		}
+func (d *Diagnostic) Error() string {
+	if d.Snippet == "" {
+		return fmt.Sprintf("unable to parse config file as %q: %s", d.Format, d.Cause)
+	}
+
+	return fmt.Sprintf("unable to parse config file as %q: %s\nSyntax error at line %d, column %d (offset %d):\n%s",
+		d.Format, d.Cause, d.Line, d.Col, d.Offset, d.Snippet)
+}
 
-		f.Seek(0, os.SEEK_SET)
+// readSource reads globals.InFilename (or stdin, for "-") fully into memory.
+func readSource(globals *GlobalConfig, bufferSize int) ([]byte, error) {
+	var r io.Reader
+	if globals.InFilename == "-" {
+		r = bufio.NewReaderSize(os.Stdin, bufferSize)
 	} else {
-		var err error
-		f, err = os.Open(m.InFilename)
+		f, err := os.Open(globals.InFilename)
 		if err != nil {
-			return errors.Wrap(err, "unable to read input")
+			return nil, errors.Wrap(err, "unable to read input")
 		}
 		defer f.Close()
+		r = f
 	}
 
 	var buf bytes.Buffer
-	if _, err := io.Copy(&buf, f); err != nil {
-		return errors.Wrap(err, "unable to read input")
+	if _, err := io.Copy(&buf, r); err != nil {
+		return nil, errors.Wrap(err, "unable to read input")
+	}
+
+	return buf.Bytes(), nil
+}
+
+// parseInput parses buf according to inputFormat, trying json, json5, hcl,
+// then yaml in turn when inputFormat is "*". When every format fails, the
+// per-format Diagnostics are aggregated into a single *multierror.Error,
+// returned wrapped with the filename, so callers get one actionable report
+// rather than an opaque slice dump.
+func parseInput(buf []byte, inputFormat, filename string) (interface{}, error) {
+	if inputFormat == "*" {
+		// Prefer extension/content detection over blindly trying every
+		// parser: it avoids, e.g., parsing a large HCL file three times,
+		// and only falls through to the try-every-parser loop below when
+		// detection itself is ambiguous.
+		if detected := DetectFormat(filename, buf); detected != "" {
+			inputFormat = detected
+		}
 	}
 
 	var raw interface{}
+	var err error
 	var tryAllFormats bool
-	errList := make([]error, 0, 3)
-	switch m.InputFormat {
+	var result *multierror.Error
+	switch inputFormat {
+	case "yaml":
+		raw, err = ParseYAML(bytes.NewReader(buf))
+		if err != nil {
+			return nil, &Diagnostic{Format: "yaml", Cause: err}
+		}
 	case "*":
 		tryAllFormats = true
 		fallthrough
 	case "json":
-		raw, err = ParseJSON(strings.NewReader(string(buf.Bytes())))
+		raw, err = ParseJSON(bytes.NewReader(buf))
 		if err == nil {
 			break
 		}
 
-		var errWrapped error
-		switch parseErr := errors.Cause(err).(type) {
-		case *json.SyntaxError:
-			f.Seek(0, os.SEEK_SET)
-			// Grab the error location, and return a string to point to offending syntax error
-			line, col, highlight := highlightPosition(f, parseErr.Offset)
-			errWrapped = errors.Wrapf(err, "unable to parse %q as %q: %s\nSyntax error at line %d, column %d (offset %d):\n%s", m.InFilename, m.InputFormat, parseErr, line, col, parseErr.Offset, highlight)
-		default:
-			errWrapped = errors.Wrapf(err, "unable to parse config file as %q", m.InputFormat)
+		diag := &Diagnostic{Format: "json", Cause: err}
+		if parseErr, ok := errors.Cause(err).(*json.SyntaxError); ok {
+			diag.Offset = parseErr.Offset
+			diag.Line, diag.Col, diag.Snippet = highlightPosition(buf, parseErr.Offset)
 		}
 
 		if !tryAllFormats {
-			return errWrapped
-		} else {
-			errList = append(errList, errWrapped)
+			return nil, diag
 		}
+		result = multierror.Append(result, diag)
 
 		fallthrough
 	case "json5":
-		raw, err = ParseJSON5(strings.NewReader(string(buf.Bytes())))
+		raw, err = ParseJSON5(bytes.NewReader(buf))
 		if err == nil {
 			break
 		}
 
-		var errWrapped error
-		switch parseErr := errors.Cause(err).(type) {
-		case *json5.SyntaxError:
-			f.Seek(0, os.SEEK_SET)
-			// Grab the error location, and return a string to point to offending syntax error
-			line, col, highlight := highlightPosition(f, parseErr.Offset)
-			errWrapped = errors.Wrapf(err, "unable to parse %q as %q: %s\nSyntax error at line %d, column %d (offset %d):\n%s", m.InFilename, m.InputFormat, parseErr, line, col, parseErr.Offset, highlight)
-		default:
-			errWrapped = errors.Wrapf(err, "unable to parse config file as %q", m.InputFormat)
+		diag := &Diagnostic{Format: "json5", Cause: err}
+		if parseErr, ok := errors.Cause(err).(*json5.SyntaxError); ok {
+			diag.Offset = parseErr.Offset
+			diag.Line, diag.Col, diag.Snippet = highlightPosition(buf, parseErr.Offset)
 		}
 
 		if !tryAllFormats {
-			return errWrapped
-		} else {
-			errList = append(errList, errWrapped)
+			return nil, diag
 		}
+		result = multierror.Append(result, diag)
 
 		fallthrough
 	case "hcl":
-		raw, err = ParseHCL(string(buf.Bytes()))
+		raw, err = ParseHCL(string(buf))
 		if err == nil {
 			break
 		}
 
-		var errWrapped error
-		switch parseErr := errors.Cause(err).(type) {
-		default:
-			_ = parseErr // Preserve structure for future and improved error handling
-			errWrapped = errors.Wrapf(err, "unable to parse config file as %q", m.InputFormat)
+		diag := &Diagnostic{Format: "hcl", Cause: err}
+
+		if !tryAllFormats {
+			return nil, diag
+		}
+		result = multierror.Append(result, diag)
+
+		fallthrough
+	case "__yamlFallback": // never matched directly; only reached by falling through from hcl
+		raw, err = ParseYAML(bytes.NewReader(buf))
+		if err == nil {
+			break
 		}
 
+		diag := &Diagnostic{Format: "yaml", Cause: err}
+
 		if !tryAllFormats {
-			return errWrapped
-		} else {
-			errList = append(errList, errWrapped)
+			return nil, diag
 		}
+		result = multierror.Append(result, diag)
 
 		fallthrough
 	default:
-		if len(errList) > 0 {
-			return fmt.Errorf("Unsupported input type: %q: %v", m.InputFormat, errList)
-		} else {
-			return fmt.Errorf("Unsupported input type: %q", m.InputFormat)
+		if result != nil {
+			return nil, errors.Wrapf(result.ErrorOrNil(), "unable to parse %q in any known format", filename)
 		}
+		return nil, fmt.Errorf("Unsupported input type: %q", inputFormat)
 	}
 
-	var w *bufio.Writer
-	switch m.OutFilename {
-	case "-":
-		w = bufio.NewWriterSize(os.Stdout, m.BufferSize)
-	default:
-		// Assume a file
-		fo, err := os.Create(m.OutFilename)
+	return raw, nil
+}
+
+// openOutput opens outFilename (or stdout, for "-") for writing and returns
+// a buffered writer along with a close func the caller must defer after
+// flushing the writer. The close func returns any fsync/close error rather
+// than panicking, so callers can fold it into their own error return.
+func openOutput(outFilename string, bufferSize int) (*bufio.Writer, func() error, error) {
+	if outFilename == "-" {
+		return bufio.NewWriterSize(os.Stdout, bufferSize), func() error { return nil }, nil
+	}
+
+	fo, err := os.Create(outFilename)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "unable to open output file")
+	}
+
+	return bufio.NewWriter(fo), func() error {
+		if err := fo.Sync(); err != nil {
+			fo.Close()
+			return errors.Wrap(err, "unable to fsync output file")
+		}
+		return errors.Wrap(fo.Close(), "unable to close output file")
+	}, nil
+}
+
+// writeAtomic renders doc via encode into a temp file created alongside
+// path, fsyncs it, optionally preserves the original at path+backupSuffix,
+// then renames the temp file over path. This avoids the truncate-in-place
+// plus panic-in-a-defer pattern the old single-shot output path used: a
+// failure partway through never leaves path itself corrupted.
+func writeAtomic(path, backupSuffix string, encode func(w io.Writer) error) error {
+	// Like gofmt -w, preserve the original file's mode across the rename
+	// rather than leaving the replacement at ioutil.TempFile's 0600. A
+	// nonexistent path (e.g. a fresh -o output file) just keeps the temp
+	// file's default mode.
+	var mode os.FileMode
+	if fi, err := os.Stat(path); err == nil {
+		mode = fi.Mode().Perm()
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".")
+	if err != nil {
+		return errors.Wrap(err, "unable to create temp file for in-place write")
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName) // no-op once the rename below succeeds
+
+	if mode != 0 {
+		if err := tmp.Chmod(mode); err != nil {
+			tmp.Close()
+			return errors.Wrap(err, "unable to preserve file mode")
+		}
+	}
+
+	w := bufio.NewWriter(tmp)
+	if err := encode(w); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "unable to flush temp file")
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "unable to fsync temp file")
+	}
+
+	if err := tmp.Close(); err != nil {
+		return errors.Wrap(err, "unable to close temp file")
+	}
+
+	if backupSuffix != "" {
+		if err := copyFile(path, path+backupSuffix); err != nil {
+			return errors.Wrap(err, "unable to write backup")
+		}
+	}
+
+	if err := os.Rename(tmpName, path); err != nil {
+		return errors.Wrap(err, "unable to rename temp file into place")
+	}
+
+	return nil
+}
+
+// copyFile copies src to dst, overwriting dst if it already exists.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, in)
+	return err
+}
+
+func (m *ParseMode) run(c *kingpin.ParseContext) (err error) {
+	if m.Stream != "" {
+		return m.runStream()
+	}
+
+	if m.InPlace && m.InFilename == "-" {
+		return fmt.Errorf("--in-place cannot be used when reading from stdin")
+	}
+
+	buf, err := readSource(m.GlobalConfig, m.BufferSize)
+	if err != nil {
+		return err
+	}
+
+	raw, err := parseInput(buf, m.InputFormat, m.InFilename)
+	if err != nil {
+		return err
+	}
+
+	if m.Query != "" {
+		raw, err = query.Eval(m.Query, raw)
 		if err != nil {
-			return errors.Wrap(err, "unable to open output file")
+			return errors.Wrap(err, "unable to evaluate query")
 		}
+	}
+
+	pretty := m.PrettyPrint && !m.InPlace && m.OutFilename == "-"
+	encode := func(w io.Writer) error {
+		switch m.OutputFormat {
+		case "json", "json5":
+			enc := json.NewEncoder(w)
 
-		// FIXME (seanc@): Need to not panic() in a defer
-		defer func() {
-			if err := fo.Close(); err != nil {
-				panic(err)
+			if pretty {
+				enc.SetIndent("", "    ")
 			}
-		}()
 
-		// FIXME (seanc@): Need to not panic() in a defer
-		defer func() {
-			if err := fo.Sync(); err != nil {
-				panic(err)
+			if err := enc.Encode(raw); err != nil {
+				return errors.Wrap(err, "unable to encode")
 			}
-		}()
+		case "hcl":
+			if err := EncodeHCL(w, raw); err != nil {
+				return errors.Wrap(err, "unable to encode")
+			}
+		case "yaml":
+			if err := EncodeYAML(w, raw); err != nil {
+				return errors.Wrap(err, "unable to encode")
+			}
+		case "toml":
+			if err := EncodeTOML(w, raw); err != nil {
+				return errors.Wrap(err, "unable to encode")
+			}
+		default:
+			return fmt.Errorf("Unsupported output type: %q", m.OutputFormat)
+		}
 
-		w = bufio.NewWriter(fo)
+		return nil
 	}
 
-	defer w.Flush()
+	if m.InPlace {
+		return writeAtomic(m.InFilename, m.Backup, encode)
+	}
+
+	w, closeOutput, err := openOutput(m.OutFilename, m.BufferSize)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := closeOutput(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}()
+	defer func() {
+		if ferr := w.Flush(); ferr != nil && err == nil {
+			err = ferr
+		}
+	}()
+
+	return encode(w)
+}
+
+// countingReader tracks the number of bytes read through it. Combined with
+// streamDecoder.Buffered(), it lets runStream work out how many bytes the
+// decoder actually consumed for a given document, as opposed to how many
+// bytes happened to be pulled into the underlying bufio.Reader's buffer.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// streamDecoder is the subset of *json.Decoder and *json5.Decoder that
+// runStream needs: Decode to pull one value off the stream, and Buffered to
+// find out how much of what's been read is still sitting unconsumed in the
+// decoder's own buffer.
+type streamDecoder interface {
+	Decode(v interface{}) error
+	Buffered() io.Reader
+}
+
+// consumed returns the number of bytes cr has delivered to dec that dec has
+// actually consumed (i.e. excluding whatever is still sitting in dec's
+// internal look-ahead buffer, unused). Reading Buffered() doesn't affect
+// subsequent decoding: it returns a view over bytes already buffered, not a
+// pull from the underlying reader.
+func consumed(cr *countingReader, dec streamDecoder) int64 {
+	buffered, _ := ioutil.ReadAll(dec.Buffered())
+	return cr.n - int64(len(buffered))
+}
+
+// runStream handles --stream: rather than slurping the entire input into a
+// bytes.Buffer, it decodes one JSON/JSON5 value at a time off a BufferSize'd
+// bufio.Reader and emits each as it goes, so large concatenated documents
+// never need to reside in memory all at once.
+func (m *ParseMode) runStream() (err error) {
+	switch m.InputFormat {
+	case "*", "json", "json5":
+	default:
+		return fmt.Errorf("--stream only supports \"json\" or \"json5\" input (got %q)", m.InputFormat)
+	}
+
+	switch m.Stream {
+	case "ndjson", "array":
+	default:
+		return fmt.Errorf(`--stream must be "ndjson" or "array" (got %q)`, m.Stream)
+	}
+
+	if m.InPlace && m.InFilename == "-" {
+		return fmt.Errorf("--in-place cannot be used when reading from stdin")
+	}
+
+	var in io.Reader
+	if m.InFilename == "-" {
+		in = os.Stdin
+	} else {
+		f, err := os.Open(m.InFilename)
+		if err != nil {
+			return errors.Wrap(err, "unable to read input")
+		}
+		defer f.Close()
+		in = f
+	}
+
+	br := bufio.NewReaderSize(in, m.BufferSize)
+
+	// Unlike parseInput, there's no try-every-format fallback available here:
+	// once a stream's bytes are consumed by the wrong decoder there's no
+	// buffered copy left to retry. So "*" is resolved once, up front, via
+	// DetectFormat against the filename/a lookahead peek (which Peek doesn't
+	// consume), rather than quietly aliasing straight to json.
+	inputFormat := m.InputFormat
+	if inputFormat == "*" {
+		peek, _ := br.Peek(512)
+		if DetectFormat(m.InFilename, peek) == "json5" {
+			inputFormat = "json5"
+		} else {
+			inputFormat = "json"
+		}
+	}
+
+	cr := &countingReader{r: br}
+
+	var dec streamDecoder
+	if inputFormat == "json5" {
+		dec = json5.NewDecoder(cr)
+	} else {
+		dec = json.NewDecoder(cr)
+	}
+
+	arrayMode := m.Stream == "array"
+	encode := func(w io.Writer) error {
+		if arrayMode {
+			io.WriteString(w, "[")
+		}
 
-	switch m.OutputFormat {
-	case "json":
 		enc := json.NewEncoder(w)
+		for first := true; ; first = false {
+			before := consumed(cr, dec)
+			var doc interface{}
+			if err := dec.Decode(&doc); err == io.EOF {
+				break
+			} else if err != nil {
+				return errors.Wrap(err, "unable to decode streamed document")
+			}
+
+			if m.MaxDocSize > 0 {
+				if size := consumed(cr, dec) - before; size > int64(m.MaxDocSize) {
+					return fmt.Errorf("document exceeds --max-doc-size (%d bytes)", m.MaxDocSize)
+				}
+			}
+
+			var err error
+			if m.Query != "" {
+				doc, err = query.Eval(m.Query, doc)
+				if err != nil {
+					return errors.Wrap(err, "unable to evaluate query")
+				}
+			}
+
+			if arrayMode && !first {
+				io.WriteString(w, ",")
+			}
 
-		if m.PrettyPrint && m.OutFilename == "-" {
-			enc.SetIndent("", "    ")
+			if err := enc.Encode(doc); err != nil {
+				return errors.Wrap(err, "unable to encode")
+			}
 		}
 
-		if err = enc.Encode(raw); err != nil {
-			return errors.Wrap(err, "unable to encode")
+		if arrayMode {
+			io.WriteString(w, "]")
 		}
-	default:
-		return fmt.Errorf("Unsupported output type: %q", m.OutputFormat)
+
+		return nil
 	}
 
-	return nil
+	if m.InPlace {
+		return writeAtomic(m.InFilename, m.Backup, encode)
+	}
+
+	w, closeOutput, err := openOutput(m.OutFilename, m.BufferSize)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := closeOutput(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}()
+	defer func() {
+		if ferr := w.Flush(); ferr != nil && err == nil {
+			err = ferr
+		}
+	}()
+
+	return encode(w)
 }
 
 // ParseHCL takes the given io.Reader and parses a Template object out of it.
@@ -272,22 +615,114 @@ func ParseJSON5(r io.Reader) (interface{}, error) {
 	return raw, nil
 }
 
-// Takes a file and the location in bytes of a parse error from
-// json5.SyntaxError.Offset and returns the line, column, and pretty-printed
-// context around the error with an arrow indicating the exact position of the
-// syntax error.
-func highlightPosition(f *os.File, pos int64) (line, col int, highlight string) {
+// ParseYAML takes the given io.Reader and parses a YAML document out of it.
+func ParseYAML(r io.Reader) (interface{}, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read YAML")
+	}
+
+	var raw interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, errors.Wrap(err, "unable to decode YAML")
+	}
+
+	return normalizeYAML(raw), nil
+}
+
+// normalizeYAML recursively converts the map[interface{}]interface{} values
+// produced by yaml.v2 into map[string]interface{}, matching the shape
+// ParseJSON and ParseJSON5 already produce so downstream encoders (notably
+// encoding/json, which rejects non-string map keys) can handle the result.
+func normalizeYAML(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{}, len(val))
+		for k, child := range val {
+			out[fmt.Sprintf("%v", k)] = normalizeYAML(child)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i, child := range val {
+			out[i] = normalizeYAML(child)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// EncodeYAML writes raw to w as YAML.
+func EncodeYAML(w io.Writer, raw interface{}) error {
+	out, err := yaml.Marshal(raw)
+	if err != nil {
+		return errors.Wrap(err, "unable to marshal YAML")
+	}
+
+	_, err = w.Write(out)
+	return err
+}
+
+// EncodeTOML writes raw to w as TOML. Like EncodeHCL, a non-map root is
+// wrapped in a synthetic "value" assignment: TOML assignments require a
+// key, so a bare array/scalar root (e.g. the result of a --query
+// projection) isn't valid TOML on its own. Integral float64 values (every
+// JSON number decodes to float64) are converted to int64 first, matching
+// formatHCLNumber, so an integer field doesn't silently become a float
+// literal when marshaled.
+func EncodeTOML(w io.Writer, raw interface{}) error {
+	doc := normalizeTOMLNumbers(raw)
+	if _, ok := doc.(map[string]interface{}); !ok {
+		doc = map[string]interface{}{"value": doc}
+	}
+
+	if err := toml.NewEncoder(w).Encode(doc); err != nil {
+		return errors.Wrap(err, "unable to marshal TOML")
+	}
+
+	return nil
+}
+
+// normalizeTOMLNumbers recursively converts integral float64 values to
+// int64, leaving everything else untouched.
+func normalizeTOMLNumbers(v interface{}) interface{} {
+	switch val := v.(type) {
+	case float64:
+		if val == float64(int64(val)) {
+			return int64(val)
+		}
+		return val
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(val))
+		for k, child := range val {
+			out[k] = normalizeTOMLNumbers(child)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i, child := range val {
+			out[i] = normalizeTOMLNumbers(child)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// Takes the input data and the location in bytes of a parse error and
+// returns the line, column, and pretty-printed context around the error with
+// an arrow indicating the exact position of the syntax error. Operating
+// directly on data (rather than re-reading a seekable file) means any
+// []byte source can be highlighted without a temp-file round trip.
+func highlightPosition(data []byte, pos int64) (line, col int, highlight string) {
 	// Modified version of the function in Camlistore by Brad Fitzpatrick
 	// https://github.com/camlistore/camlistore/blob/4b5403dd5310cf6e1ae8feb8533fd59262701ebc/vendor/go4.org/errorutil/highlight.go
 	line = 1
-	br := bufio.NewReader(f)
 	lastLine := ""
 	thisLine := new(bytes.Buffer)
-	for n := int64(0); n < pos; n++ {
-		b, err := br.ReadByte()
-		if err != nil {
-			break
-		}
+	for n := int64(0); n < pos && int(n) < len(data); n++ {
+		b := data[n]
 		if b == '\n' {
 			lastLine = thisLine.String()
 			thisLine.Reset()
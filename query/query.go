@@ -0,0 +1,202 @@
+// Package query implements a small JSONPath/jq-lite evaluator for
+// projecting a sub-tree out of the map[string]interface{}/[]interface{}
+// documents produced by cfgt's format parsers. It supports dotted field
+// access, integer and wildcard indexing, and a single-condition ?(...)
+// predicate, e.g. ".builders[0].type" or `.provisioners[?(.type=="shell")]`.
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// step is one segment of a parsed expression.
+type step interface {
+	apply(v interface{}) (interface{}, error)
+}
+
+// Eval evaluates expr against raw and returns the resulting scalar or
+// sub-document.
+func Eval(expr string, raw interface{}) (interface{}, error) {
+	steps, err := parse(expr)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse query %q: %s", expr, err)
+	}
+
+	result, err := applySteps(steps, raw)
+	if err != nil {
+		return nil, fmt.Errorf("unable to evaluate query %q: %s", expr, err)
+	}
+
+	return result, nil
+}
+
+// applySteps threads v through steps in order. A wildcardStep is special:
+// rather than being applied like any other step, it maps the remainder of
+// steps over each element of the current array and collects the results,
+// so e.g. ".builders[*].type" yields one type per builder instead of
+// applying ".type" to the array itself.
+func applySteps(steps []step, v interface{}) (interface{}, error) {
+	for i, s := range steps {
+		if _, ok := s.(wildcardStep); ok {
+			arr, ok := v.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("cannot apply [*] to %T", v)
+			}
+
+			rest := steps[i+1:]
+			out := make([]interface{}, len(arr))
+			for j, elem := range arr {
+				resolved, err := applySteps(rest, elem)
+				if err != nil {
+					return nil, err
+				}
+				out[j] = resolved
+			}
+
+			return out, nil
+		}
+
+		var err error
+		v, err = s.apply(v)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return v, nil
+}
+
+type fieldStep struct{ name string }
+
+func (s fieldStep) apply(v interface{}) (interface{}, error) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("cannot select field %q from %T", s.name, v)
+	}
+
+	child, ok := m[s.name]
+	if !ok {
+		return nil, fmt.Errorf("field %q not found", s.name)
+	}
+
+	return child, nil
+}
+
+type indexStep struct{ idx int }
+
+func (s indexStep) apply(v interface{}) (interface{}, error) {
+	arr, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("cannot index into %T", v)
+	}
+
+	if s.idx < 0 || s.idx >= len(arr) {
+		return nil, fmt.Errorf("index %d out of range (len %d)", s.idx, len(arr))
+	}
+
+	return arr[s.idx], nil
+}
+
+// wildcardStep is never run through apply(); applySteps special-cases it so
+// it can map the rest of the expression over each array element instead of
+// operating on the array as a single value.
+type wildcardStep struct{}
+
+func (s wildcardStep) apply(v interface{}) (interface{}, error) {
+	return nil, fmt.Errorf("[*] must be handled by applySteps, not apply()")
+}
+
+// predicateStep filters a []interface{} of map[string]interface{} elements,
+// keeping only those whose field stringifies to value.
+type predicateStep struct {
+	field string
+	value string
+}
+
+func (s predicateStep) apply(v interface{}) (interface{}, error) {
+	arr, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("cannot filter %T", v)
+	}
+
+	out := make([]interface{}, 0, len(arr))
+	for _, item := range arr {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if fmt.Sprintf("%v", m[s.field]) == s.value {
+			out = append(out, item)
+		}
+	}
+
+	return out, nil
+}
+
+// parse splits expr into a sequence of steps. Grammar (each element
+// optional and chainable): ".name", "[N]", "[*]", `[?(.field=="value")]`.
+func parse(expr string) ([]step, error) {
+	var steps []step
+	i, n := 0, len(expr)
+	for i < n {
+		switch expr[i] {
+		case '.':
+			i++
+			start := i
+			for i < n && expr[i] != '.' && expr[i] != '[' {
+				i++
+			}
+			name := expr[start:i]
+			if name == "" {
+				return nil, fmt.Errorf("empty field name at offset %d", start)
+			}
+			steps = append(steps, fieldStep{name: name})
+		case '[':
+			end := strings.IndexByte(expr[i:], ']')
+			if end == -1 {
+				return nil, fmt.Errorf("unterminated %q starting at offset %d", "[", i)
+			}
+			inner := expr[i+1 : i+end]
+			i += end + 1
+
+			switch {
+			case inner == "*":
+				steps = append(steps, wildcardStep{})
+			case strings.HasPrefix(inner, "?("):
+				pred, err := parsePredicate(inner)
+				if err != nil {
+					return nil, err
+				}
+				steps = append(steps, pred)
+			default:
+				idx, err := strconv.Atoi(inner)
+				if err != nil {
+					return nil, fmt.Errorf("invalid index %q: %s", inner, err)
+				}
+				steps = append(steps, indexStep{idx: idx})
+			}
+		default:
+			return nil, fmt.Errorf("unexpected character %q at offset %d", expr[i], i)
+		}
+	}
+
+	return steps, nil
+}
+
+// parsePredicate parses the body of a "[?(...)]" segment, e.g.
+// `?(.type=="docker")`.
+func parsePredicate(inner string) (predicateStep, error) {
+	body := strings.TrimSuffix(strings.TrimPrefix(inner, "?("), ")")
+
+	parts := strings.SplitN(body, "==", 2)
+	if len(parts) != 2 {
+		return predicateStep{}, fmt.Errorf(`unsupported predicate %q: expected ?(.field=="value")`, inner)
+	}
+
+	field := strings.TrimPrefix(strings.TrimSpace(parts[0]), ".")
+	value := strings.Trim(strings.TrimSpace(parts[1]), `"`)
+
+	return predicateStep{field: field, value: value}, nil
+}
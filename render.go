@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	isatty "github.com/mattn/go-isatty"
+	"github.com/pkg/errors"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/sean-/cfgt/template"
+)
+
+type RenderMode struct {
+	*GlobalConfig
+	BufferSize  int
+	PrettyPrint bool
+	InputFormat string
+}
+
+func NewRenderMode(globals *GlobalConfig) RenderMode {
+	return RenderMode{
+		GlobalConfig: globals,
+		BufferSize:   DefaultBufferSize,
+	}
+}
+
+func ConfigureRenderCommand(app *kingpin.Application, globals *GlobalConfig) error {
+	renderMode := NewRenderMode(globals)
+
+	renderCommand := app.Command("render", "Resolve a configuration template's variables and re-emit it").
+		Action(renderMode.run)
+
+	renderCommand.Flag("in-format", `Input format ("json", "json5", "hcl", or "yaml")`).
+		Short('I').
+		Default("*").
+		StringVar(&renderMode.InputFormat)
+
+	renderCommand.Flag("pretty", "Pretty-print the output (true if output is a terminal)").
+		Short('p').
+		Default(fmt.Sprintf("%t", isatty.IsTerminal(os.Stdout.Fd()))).
+		BoolVar(&renderMode.PrettyPrint)
+
+	return nil
+}
+
+func (m *RenderMode) run(c *kingpin.ParseContext) error {
+	buf, err := readSource(m.GlobalConfig, m.BufferSize)
+	if err != nil {
+		return err
+	}
+
+	raw, err := parseInput(buf, m.InputFormat, m.InFilename)
+	if err != nil {
+		return err
+	}
+
+	tmpl, err := template.Parse(raw)
+	if err != nil {
+		return errors.Wrap(err, "unable to parse template")
+	}
+
+	if err := tmpl.CheckMinVersion(Version); err != nil {
+		return errors.Wrap(err, "template is incompatible with this version of cfgt")
+	}
+
+	var w *bufio.Writer
+	switch m.OutFilename {
+	case "-":
+		w = bufio.NewWriterSize(os.Stdout, m.BufferSize)
+	default:
+		fo, err := os.Create(m.OutFilename)
+		if err != nil {
+			return errors.Wrap(err, "unable to open output file")
+		}
+		defer fo.Close()
+
+		w = bufio.NewWriter(fo)
+	}
+	defer w.Flush()
+
+	enc := json.NewEncoder(w)
+	if m.PrettyPrint && m.OutFilename == "-" {
+		enc.SetIndent("", "    ")
+	}
+
+	if err := enc.Encode(tmpl.Render()); err != nil {
+		return errors.Wrap(err, "unable to encode")
+	}
+
+	return nil
+}
@@ -0,0 +1,243 @@
+// Package template decodes the raw interface{} produced by cfgt's format
+// parsers (ParseJSON, ParseJSON5, ParseHCL) into a strongly typed Template,
+// resolving ${var.name} and ${env.NAME} references along the way. The
+// rawTemplate/Template split mirrors the approach used by Packer's template
+// package: rawTemplate is the direct mapstructure decoding of the document,
+// and Template is its fully resolved form.
+package template
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/go-version"
+	"github.com/mitchellh/mapstructure"
+)
+
+// rawTemplate is the direct decoding of a parsed configuration document,
+// before variable interpolation and validation are applied.
+type rawTemplate struct {
+	MinVersion         string                 `mapstructure:"min_version"`
+	Variables          map[string]string      `mapstructure:"variables"`
+	SensitiveVariables []string               `mapstructure:"sensitive-variables"`
+	Sections           map[string]interface{} `mapstructure:",remain"`
+}
+
+// Template is the fully resolved, interpolated form of a configuration
+// document: every ${var.name} and ${env.NAME} reference in Variables and
+// Sections has been substituted. Sections see the resolved variable values;
+// a ${var.name} inside a variable's own value is replaced by that variable's
+// declared value, without resolving references within it again.
+type Template struct {
+	MinVersion         string
+	Variables          map[string]string
+	SensitiveVariables map[string]bool
+	Sections           map[string]interface{}
+}
+
+// interpRef matches ${var.NAME} and ${env.NAME} references.
+var interpRef = regexp.MustCompile(`\$\{(var|env)\.([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// Parse decodes raw into a Template, resolving variable and environment
+// references and validating sensitive-variables declarations. Every error
+// encountered is aggregated via hashicorp/go-multierror rather than
+// returning on the first failure.
+func Parse(raw interface{}) (*Template, error) {
+	var rt rawTemplate
+	if err := mapstructure.Decode(raw, &rt); err != nil {
+		return nil, fmt.Errorf("unable to decode template: %s", err)
+	}
+
+	var result *multierror.Error
+
+	sensitive := make(map[string]bool, len(rt.SensitiveVariables))
+	for _, name := range rt.SensitiveVariables {
+		if _, ok := rt.Variables[name]; !ok {
+			result = multierror.Append(result, fmt.Errorf("sensitive-variables references undeclared variable %q", name))
+			continue
+		}
+		sensitive[name] = true
+	}
+
+	t := &Template{
+		MinVersion:         rt.MinVersion,
+		Variables:          make(map[string]string, len(rt.Variables)),
+		SensitiveVariables: sensitive,
+		Sections:           make(map[string]interface{}, len(rt.Sections)),
+	}
+
+	for name, value := range rt.Variables {
+		resolved, err := interpolate(value, rt.Variables)
+		if err != nil {
+			result = multierror.Append(result, fmt.Errorf("variable %q: %s", name, err))
+			continue
+		}
+		t.Variables[name] = resolved
+	}
+
+	for name, section := range rt.Sections {
+		resolved, err := interpolateValue(section, t.Variables)
+		if err != nil {
+			result = multierror.Append(result, fmt.Errorf("section %q: %s", name, err))
+			continue
+		}
+		t.Sections[name] = resolved
+	}
+
+	return t, result.ErrorOrNil()
+}
+
+// CheckMinVersion reports an error if current does not satisfy t's
+// min_version constraint. A Template with no min_version declared always
+// satisfies the check.
+func (t *Template) CheckMinVersion(current string) error {
+	if t.MinVersion == "" {
+		return nil
+	}
+
+	currentVer, err := version.NewVersion(current)
+	if err != nil {
+		return fmt.Errorf("unable to parse current version %q: %s", current, err)
+	}
+
+	minVer, err := version.NewVersion(t.MinVersion)
+	if err != nil {
+		return fmt.Errorf("unable to parse min_version %q: %s", t.MinVersion, err)
+	}
+
+	if currentVer.LessThan(minVer) {
+		return fmt.Errorf("template requires cfgt >= %s, running %s", minVer, currentVer)
+	}
+
+	return nil
+}
+
+// redactedPlaceholder replaces the value of any sensitive-variables entry in
+// Render's output, so a rendered template never leaks a secret in plaintext.
+const redactedPlaceholder = "(sensitive value)"
+
+// Render returns the resolved document (Variables merged under "variables"
+// alongside the named Sections) ready to be re-emitted by one of cfgt's
+// output encoders. Variables declared in sensitive-variables are redacted
+// rather than rendered in plaintext, both in the "variables" block itself
+// and anywhere else their value was interpolated into a Section during
+// Parse.
+func (t *Template) Render() map[string]interface{} {
+	secrets := make([]string, 0, len(t.SensitiveVariables))
+	for name := range t.SensitiveVariables {
+		if t.SensitiveVariables[name] {
+			secrets = append(secrets, t.Variables[name])
+		}
+	}
+
+	out := make(map[string]interface{}, len(t.Sections)+1)
+	for name, section := range t.Sections {
+		out[name] = redact(section, secrets)
+	}
+
+	vars := make(map[string]interface{}, len(t.Variables))
+	for name, value := range t.Variables {
+		if t.SensitiveVariables[name] {
+			vars[name] = redactedPlaceholder
+			continue
+		}
+		vars[name] = value
+	}
+	out["variables"] = vars
+
+	return out
+}
+
+// redact walks v (as produced by interpolateValue) and replaces every
+// occurrence of a secret value found in secrets with redactedPlaceholder, so
+// a sensitive variable interpolated into a Section can't leak into Render's
+// output just because it isn't the "variables" block.
+func redact(v interface{}, secrets []string) interface{} {
+	switch val := v.(type) {
+	case string:
+		for _, secret := range secrets {
+			if secret == "" {
+				continue
+			}
+			val = strings.ReplaceAll(val, secret, redactedPlaceholder)
+		}
+		return val
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(val))
+		for k, child := range val {
+			out[k] = redact(child, secrets)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i, child := range val {
+			out[i] = redact(child, secrets)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// interpolateValue recursively resolves ${var.name} and ${env.NAME}
+// references found in strings nested anywhere within v.
+func interpolateValue(v interface{}, vars map[string]string) (interface{}, error) {
+	switch val := v.(type) {
+	case string:
+		return interpolate(val, vars)
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(val))
+		for k, child := range val {
+			resolved, err := interpolateValue(child, vars)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = resolved
+		}
+		return out, nil
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i, child := range val {
+			resolved, err := interpolateValue(child, vars)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = resolved
+		}
+		return out, nil
+	default:
+		return v, nil
+	}
+}
+
+// interpolate resolves every ${var.name} and ${env.NAME} reference in s.
+func interpolate(s string, vars map[string]string) (string, error) {
+	var firstErr error
+	out := interpRef.ReplaceAllStringFunc(s, func(match string) string {
+		groups := interpRef.FindStringSubmatch(match)
+		switch groups[1] {
+		case "var":
+			val, ok := vars[groups[2]]
+			if !ok {
+				if firstErr == nil {
+					firstErr = fmt.Errorf("undefined variable %q", groups[2])
+				}
+				return match
+			}
+			return val
+		case "env":
+			return os.Getenv(groups[2])
+		default:
+			return match
+		}
+	})
+
+	if firstErr != nil {
+		return "", firstErr
+	}
+
+	return out, nil
+}